@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/billygrinding/mmk-be/pkg/dbresolver"
 )
 
 type Postgres struct {
@@ -12,6 +14,10 @@ type Postgres struct {
 	User     string `envconfig:"POSTGRES_USER" required:"true"`
 	Password string `envconfig:"POSTGRES_PASSWORD" required:"true"`
 	Dbname   string `envconfig:"POSTGRES_DB" required:"true" default:"postgres"`
+	// Driver selects the database/sql driver used to open connections and,
+	// transitively, the dbresolver.ErrorClassifier used for RO failover.
+	// One of dbresolver.DriverLibPQ, dbresolver.DriverPGXV5.
+	Driver string `envconfig:"POSTGRES_DRIVER" default:"postgres"`
 
 	MaxConnectionLifetime          time.Duration `envconfig:"DB_MAX_CONN_LIFE_TIME" required:"true" default:"300s"`
 	MaxOpenConnection              int           `envconfig:"DB_MAX_OPEN_CONNECTION" required:"true" default:"100"`
@@ -19,6 +25,18 @@ type Postgres struct {
 	DBInitializationConnectTimeout int           `envconfig:"DB_INITIALIZATION_CONNECT_TIMEOUT" default:"2"`
 }
 
+// Classifier returns the dbresolver.ErrorClassifier matching p.Driver, so
+// callers can wire up dbresolver.Open/WrapDatabaseConnection with
+// dbresolver.WithErrorClassifier(pg.Classifier()).
+func (p Postgres) Classifier() dbresolver.ErrorClassifier {
+	switch p.Driver {
+	case dbresolver.DriverPGXV5:
+		return dbresolver.PGXV5Classifier{}
+	default:
+		return dbresolver.PQClassifier{}
+	}
+}
+
 func (p Postgres) ConnectionString() string {
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", p.Host, p.Port, p.User, p.Password, p.Dbname)
 }
@@ -34,7 +52,7 @@ func (p Postgres) ConnectionStringWithTimeout() string {
 }
 
 func OpenDatabaseConnection(pg Postgres) (*sql.DB, error) {
-	dbConn, err := sql.Open("postgres", pg.ConnectionString())
+	dbConn, err := sql.Open(pg.Driver, pg.ConnectionString())
 	if err != nil {
 		return nil, err
 	}
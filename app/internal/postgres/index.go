@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/billygrinding/mmk-be/pkg/dbresolver"
 	"time"
 
@@ -23,7 +24,6 @@ type Suite struct {
 	suite.Suite
 	DSN                     string
 	DBConn                  *dbresolver.DB
-	Migration               *migration
 	MigrationLocationFolder string
 	DBName                  string
 }
@@ -35,7 +35,7 @@ func (s *Suite) SetupSuite() {
 	var err error
 	dbConn, err := sql.Open(postgres, s.DSN)
 	s.Require().NoError(err)
-	s.DBConn = dbresolver.WrapDatabaseConnection(dbConn, nil)
+	s.DBConn = dbresolver.WrapDatabaseConnection(dbConn, nil, dbresolver.WithMigrationConn(postgres, s.DSN))
 	pingCtx, cancel := context.WithTimeout(context.Background(), timeoutForDBPing)
 	defer cancel()
 
@@ -43,7 +43,7 @@ func (s *Suite) SetupSuite() {
 	s.Require().NoError(err)
 	_, extenErr := s.DBConn.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\";")
 	s.Require().NoError(extenErr)
-	s.Migration, err = runMigration(s.DBConn.ReadWrite(), s.MigrationLocationFolder)
+	err = s.DBConn.Migrate(fmt.Sprintf("file://%s", s.MigrationLocationFolder))
 	s.Require().NoError(err)
 }
 
@@ -0,0 +1,126 @@
+package dbresolver
+
+import (
+	"strings"
+
+	pgxv5conn "github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// Driver name constants identifying the sql/driver implementation a
+// Postgres connection string is opened with. Each value is the name the
+// driver registers with database/sql, so it can be passed to sql.Open as
+// well as used to select the matching ErrorClassifier.
+const (
+	DriverLibPQ = "postgres"
+	DriverPGXV5 = "pgx/v5"
+)
+
+// ErrorClassifier inspects driver errors returned from a physical database
+// so DB can decide whether to fail over from RO to RW and whether a failed
+// call can be safely retried. Different Postgres drivers wrap the same
+// server error codes in different Go types, so the classification logic
+// must be driver-aware.
+type ErrorClassifier interface {
+	// IsConnectionError reports whether err indicates the underlying
+	// connection is unusable, meaning callers should fail over to RW.
+	IsConnectionError(err error) bool
+	// IsRetryable reports whether err is transient and the same query
+	// can be retried against the same pool without side effects.
+	IsRetryable(err error) bool
+}
+
+// connectionErrorCodes is shared across classifiers: copied from
+// https://www.postgresql.org/docs/9.3/errcodes-appendix.html
+//
+//	"08000": "connection_exception",
+//	"08003": "connection_does_not_exist",
+//	"08006": "connection_failure",
+//	"08001": "sqlclient_unable_to_establish_sqlconnection",
+//	"08004": "sqlserver_rejected_establishment_of_sqlconnection",
+//	"08007": "transaction_resolution_unknown",
+//	"08P01": "protocol_violation",
+//	57P01	admin_shutdown
+//	57P02	crash_shutdown
+//	57P03	cannot_connect_now //shutting down, restart up
+//
+//	53000	insufficient_resources
+//	53100	disk_full
+//	53200	out_of_memory
+//	53300	too_many_connections
+//	53400	configuration_limit_exceeded
+var connectionErrorCodes = []string{
+	"08000", "08003", "08006", "08001", "08004", "08007", "08P01",
+	"57P01", "57P02", "57P03",
+	"53000", "53100", "53200", "53300", "53400",
+}
+
+// retryableErrorCodes holds codes for errors that are transient and safe
+// to retry against the same pool, as opposed to connection errors which
+// require failing over to a different pool.
+var retryableErrorCodes = []string{
+	"40001", // serialization_failure
+	"40P01", // deadlock_detected
+}
+
+// isNetworkLevelError catches errors surfaced by the network/runtime
+// rather than wrapped in a driver-specific error type, e.g. when the db
+// is stopped and never gets the chance to speak the Postgres protocol.
+func isNetworkLevelError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "connection reset by peer") ||
+		strings.Contains(err.Error(), "connection refused") ||
+		strings.Contains(err.Error(), "timed out") ||
+		strings.Contains(err.Error(), "timeout") ||
+		strings.Contains(err.Error(), "starting up") ||
+		strings.Contains(err.Error(), "EOF")
+}
+
+// PQClassifier classifies errors returned by github.com/lib/pq. It is the
+// default classifier, preserving the historical behavior of this package.
+type PQClassifier struct{}
+
+func (PQClassifier) IsConnectionError(err error) bool {
+	if isNetworkLevelError(err) {
+		return true
+	}
+	errPG, ok := err.(*pq.Error)
+	if !ok {
+		return false
+	}
+	return ArrayContainsStr(connectionErrorCodes, string(errPG.Code))
+}
+
+func (PQClassifier) IsRetryable(err error) bool {
+	errPG, ok := err.(*pq.Error)
+	if !ok {
+		return false
+	}
+	return ArrayContainsStr(retryableErrorCodes, string(errPG.Code))
+}
+
+// PGXV5Classifier classifies errors returned by jackc/pgx/v5/stdlib, which
+// wraps server errors as *pgconn.PgError from the v5 module's own vendored
+// pgconn package rather than *pq.Error.
+type PGXV5Classifier struct{}
+
+func (PGXV5Classifier) IsConnectionError(err error) bool {
+	if isNetworkLevelError(err) {
+		return true
+	}
+	errPG, ok := err.(*pgxv5conn.PgError)
+	if !ok {
+		return false
+	}
+	return ArrayContainsStr(connectionErrorCodes, errPG.Code)
+}
+
+func (PGXV5Classifier) IsRetryable(err error) bool {
+	errPG, ok := err.(*pgxv5conn.PgError)
+	if !ok {
+		return false
+	}
+	return ArrayContainsStr(retryableErrorCodes, errPG.Code)
+}
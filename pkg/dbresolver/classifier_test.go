@@ -0,0 +1,69 @@
+package dbresolver
+
+import (
+	"errors"
+	"testing"
+
+	pgxv5conn "github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+func TestPQClassifier(t *testing.T) {
+	c := PQClassifier{}
+
+	tests := []struct {
+		name        string
+		err         error
+		wantConnErr bool
+		wantRetry   bool
+	}{
+		{"nil error", nil, false, false},
+		{"connection_exception", &pq.Error{Code: "08000"}, true, false},
+		{"too_many_connections", &pq.Error{Code: "53300"}, true, false},
+		{"serialization_failure", &pq.Error{Code: "40001"}, false, true},
+		{"deadlock_detected", &pq.Error{Code: "40P01"}, false, true},
+		{"unrelated code", &pq.Error{Code: "42601"}, false, false},
+		{"network level", errors.New("dial tcp: connection refused"), true, false},
+		{"wrong error type", &pgxv5conn.PgError{Code: "08000"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.IsConnectionError(tt.err); got != tt.wantConnErr {
+				t.Errorf("IsConnectionError(%v) = %v, want %v", tt.err, got, tt.wantConnErr)
+			}
+			if got := c.IsRetryable(tt.err); got != tt.wantRetry {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestPGXV5Classifier(t *testing.T) {
+	c := PGXV5Classifier{}
+
+	tests := []struct {
+		name        string
+		err         error
+		wantConnErr bool
+		wantRetry   bool
+	}{
+		{"nil error", nil, false, false},
+		{"admin_shutdown", &pgxv5conn.PgError{Code: "57P01"}, true, false},
+		{"deadlock_detected", &pgxv5conn.PgError{Code: "40P01"}, false, true},
+		{"unrelated code", &pgxv5conn.PgError{Code: "42601"}, false, false},
+		{"network level", errors.New("i/o timeout"), true, false},
+		{"wrong error type", &pq.Error{Code: "57P01"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.IsConnectionError(tt.err); got != tt.wantConnErr {
+				t.Errorf("IsConnectionError(%v) = %v, want %v", tt.err, got, tt.wantConnErr)
+			}
+			if got := c.IsRetryable(tt.err); got != tt.wantRetry {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -6,50 +6,153 @@ import (
 	"database/sql/driver"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/lib/pq"
 )
 
 // DB is a logical database with multiple underlying physical databases
 // forming a single ReadWrite with multiple ReadOnly database.
 // Reads and writes are automatically directed to the correct physical db.
 type DB struct {
-	rwdb            *sql.DB
-	rodb            *sql.DB
-	totalConnection int
+	rwdb       *sql.DB
+	replicas   []*replica
+	classifier ErrorClassifier
+	balancer   LoadBalancer
+
+	healthCheckCfg    HealthCheckConfig
+	healthCheckCancel context.CancelFunc
+	healthCheckDone   chan struct{}
+	failoverCount     int64 // atomic: cumulative calls served by RW in place of RO
+
+	lagPolicy *ReplicaLagPolicy
+	lagCancel context.CancelFunc
+	lagDone   chan struct{}
+
+	migrateSourceURL  string
+	migrateCfg        MigrationConfig
+	migrateDriverName string
+	migrateDSN        string
+
+	connOpener     ConnOpener
+	connDecorators []ConnDecorator
+	failoverHooks  []FailoverHook
+}
+
+// replica is a single RO physical database plus the health state the
+// background checks maintain for it.
+type replica struct {
+	db      *sql.DB
+	weight  int
+	healthy int32 // atomic: 1 when the replica answered its last probe
+	lagOK   int32 // atomic: 1 when the replica's lag is within policy
+}
+
+// inRotation reports whether r should currently be eligible to serve reads.
+func (r *replica) inRotation() bool {
+	return atomic.LoadInt32(&r.healthy) == 1 && atomic.LoadInt32(&r.lagOK) == 1
 }
 
 // Open concurrently opens each underlying physical db.
-// dataSourceNames must be a semi-comma separated list of DSNs with the first
-// one being used as the RW-database and the rest as RO-database.
-func Open(driverName, dataSourceNames string) (db *DB, err error) {
-	db = &DB{}
+// dataSourceNames must be a semi-comma separated list of DSNs with the
+// first one being used as the RW-database and the rest as RO-databases.
+// Each RO DSN may carry a "weight" query-string parameter (e.g.
+// "postgres://host/db?weight=3") consumed by WeightedRandomBalancer.
+//
+// By default, errors are classified assuming github.com/lib/pq. Pass
+// WithErrorClassifier to select a different driver, e.g. when driverName
+// is DriverPGXV5 ("pgx/v5").
+//
+// driverName and the RW DSN are remembered so Migrate can open its own
+// short-lived connection for golang-migrate instead of borrowing one
+// from the RW pool; pass WithMigrationConn to override either, which is
+// required when constructing DB via WrapDatabaseConnection instead.
+func Open(driverName, dataSourceNames string, opts ...Option) (db *DB, err error) {
 	conns := strings.Split(dataSourceNames, ";")
-	db.totalConnection = len(conns)
-	if len(conns) > 2 {
-		db.totalConnection = 2
+
+	db = &DB{
+		replicas:          make([]*replica, len(conns)-1),
+		migrateDriverName: driverName,
+		migrateDSN:        conns[0],
 	}
+	applyOptions(db, opts)
 
-	err = doParallely(db.totalConnection, func(i int) (err error) {
+	err = doParallely(len(conns), func(i int) (err error) {
 		if i == 0 {
-			db.rwdb, err = sql.Open(driverName, conns[i])
+			db.rwdb, err = db.openConn("rw", driverName, conns[i])
 			return err
 		}
-		db.rodb, err = sql.Open(driverName, conns[i])
-		return err
+
+		dsn, weight := parseReplicaWeight(conns[i])
+		rodb, err := db.openConn("ro", driverName, dsn)
+		if err != nil {
+			return err
+		}
+		db.replicas[i-1] = &replica{db: rodb, weight: weight, healthy: 1, lagOK: 1}
+		return nil
 	})
+	if err != nil {
+		// One of the physical dbs failed to open, leaving some
+		// db.replicas slots nil. Return before decorateConns or the
+		// background health/lag probes start, since both range over
+		// every slot in db.replicas.
+		return db, err
+	}
+
+	db.decorateConns()
+	db.startHealthCheck()
+	db.startLagMonitor()
 
-	return db, err
+	return db, nil
 }
 
-// Close closes all physical databases concurrently, releasing any open resources.
-func (db *DB) Close() error {
-	return doParallely(db.totalConnection, func(i int) (err error) {
-		if i == 0 {
-			return db.rwdb.Close()
+// openConn opens a single connection for role ("rw" or "ro"), via the
+// ConnOpener installed by WithConnOpener if any, or sql.Open otherwise.
+func (db *DB) openConn(role, driverName, dataSourceName string) (*sql.DB, error) {
+	if db.connOpener != nil {
+		return db.connOpener(role, driverName, dataSourceName)
+	}
+	return sql.Open(driverName, dataSourceName)
+}
+
+// decorateConns runs every ConnDecorator installed by WithConnDecorator
+// against RW and each replica, tagging them with their role.
+func (db *DB) decorateConns() {
+	for _, dec := range db.connDecorators {
+		dec(db.rwdb, "rw")
+		for _, r := range db.replicas {
+			dec(r.db, "ro")
 		}
-		return db.rodb.Close()
+	}
+}
+
+// runFailoverHooks invokes every FailoverHook installed by
+// WithFailoverHook, reporting that a read was taken away from role and
+// served by RW instead.
+func (db *DB) runFailoverHooks(ctx context.Context, role string) {
+	for _, hook := range db.failoverHooks {
+		hook(ctx, role)
+	}
+}
+
+func applyOptions(db *DB, opts []Option) {
+	for _, opt := range opts {
+		opt(db)
+	}
+	if db.classifier == nil {
+		db.classifier = PQClassifier{}
+	}
+	if db.balancer == nil {
+		db.balancer = NewRoundRobinBalancer()
+	}
+}
+
+// Close stops the background RO health and lag checks, then closes all
+// physical databases concurrently, releasing any open resources.
+func (db *DB) Close() error {
+	db.stopHealthCheck()
+	db.stopLagMonitor()
+	return db.forEachConnConcurrently(func(conn *sql.DB) error {
+		return conn.Close()
 	})
 }
 
@@ -82,72 +185,56 @@ func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
 // ExecContext executes a query without returning any rows.
 // The args are for any placeholder parameters in the query.
 // Exec uses the RW-database as the underlying physical db.
+//
+// When ctx was derived from WithReadYourWrites, the RW LSN this write
+// commits at is recorded so subsequent reads sharing ctx observe it.
 func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	return db.ReadWrite().ExecContext(ctx, query, args...)
+	res, err := db.ReadWrite().ExecContext(ctx, query, args...)
+	db.recordWriteLSN(ctx, err)
+	return res, err
 }
 
 // Ping verifies if a connection to each physical database is still alive,
 // establishing a connection if necessary.
 func (db *DB) Ping() error {
-	err := db.rwdb.Ping()
-	if err != nil {
-		return err
-	}
-
-	if db.rodb != nil {
-		return db.rodb.Ping()
-	}
-
-	return nil
+	return db.forEachConn(func(conn *sql.DB) error {
+		return conn.Ping()
+	})
 }
 
 // PingContext verifies if a connection to each physical database is still
 // alive, establishing a connection if necessary.
 func (db *DB) PingContext(ctx context.Context) error {
-	var errRODB, errRWDB error
-
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-
-	go func() {
-		errRWDB = db.rwdb.PingContext(ctx)
-		wg.Done()
-	}()
-
-	if db.rodb != nil {
-		wg.Add(1)
-		go func() {
-			errRODB = db.rodb.PingContext(ctx)
-			wg.Done()
-		}()
-	}
-
-	wg.Wait()
-
-	if errRWDB != nil && errRODB != nil {
-		return errRWDB
-	}
-
-	return nil
+	var mu sync.Mutex
+	var firstErr error
+	_ = db.forEachConnConcurrently(func(conn *sql.DB) error {
+		err := conn.PingContext(ctx)
+		if err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}
+		return nil
+	})
+	return firstErr
 }
 
 // Prepare creates a prepared statement for later queries or executions
 // on each physical database, concurrently.
 func (db *DB) Prepare(query string) (Stmt, error) {
 	stmt := &stmt{
-		db: db,
+		db:      db,
+		rostmts: make([]*sql.Stmt, len(db.replicas)),
 	}
-	err := doParallely(db.totalConnection, func(i int) (err error) {
+	err := doParallely(1+len(db.replicas), func(i int) (err error) {
 		if i == 0 {
 			stmt.rwstmt, err = db.rwdb.Prepare(query)
 			return err
 		}
-
-		if db.rodb != nil {
-			stmt.rostmt, err = db.rodb.Prepare(query)
-			return err
-		}
-		return nil
+		stmt.rostmts[i-1], err = db.replicas[i-1].db.Prepare(query)
+		return err
 	})
 
 	if err != nil {
@@ -164,19 +251,16 @@ func (db *DB) Prepare(query string) (Stmt, error) {
 // the execution of the statement.
 func (db *DB) PrepareContext(ctx context.Context, query string) (Stmt, error) {
 	stmt := &stmt{
-		db: db,
+		db:      db,
+		rostmts: make([]*sql.Stmt, len(db.replicas)),
 	}
-	err := doParallely(db.totalConnection, func(i int) (err error) {
+	err := doParallely(1+len(db.replicas), func(i int) (err error) {
 		if i == 0 {
 			stmt.rwstmt, err = db.rwdb.PrepareContext(ctx, query)
 			return err
 		}
-
-		if db.rodb != nil {
-			stmt.rostmt, err = db.rodb.PrepareContext(ctx, query)
-			return err
-		}
-		return nil
+		stmt.rostmts[i-1], err = db.replicas[i-1].db.PrepareContext(ctx, query)
+		return err
 	})
 
 	if err != nil {
@@ -190,8 +274,12 @@ func (db *DB) PrepareContext(ctx context.Context, query string) (Stmt, error) {
 // The args are for any placeholder parameters in the query.
 // Query uses a RO database as the physical db.
 func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	ret, err := db.ReadOnly().Query(query, args...)
+	ro := db.ReadOnly()
+	ret, err := ro.Query(query, args...)
 	if db.isConnectionError(err) {
+		db.evictReplica(ro)
+		atomic.AddInt64(&db.failoverCount, 1)
+		db.runFailoverHooks(context.Background(), "ro")
 		return db.ReadWrite().Query(query, args...)
 	}
 	return ret, err
@@ -199,11 +287,17 @@ func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 
 // QueryContext executes a query that returns rows, typically a SELECT.
 // The args are for any placeholder parameters in the query.
-// QueryContext uses a RO database as the physical db.
+// QueryContext uses a RO database as the physical db, unless ctx was
+// derived from WithReadYourWrites and RO has not yet replayed a prior
+// write, in which case it uses RW.
 func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	ret, err := db.ReadOnly().QueryContext(ctx, query, args...)
+	ro := db.resolveReadDB(ctx)
+	ret, err := ro.QueryContext(ctx, query, args...)
 	if db.isConnectionError(err) {
-		return db.ReadWrite().QueryContext(ctx, query, args...)
+		db.evictReplica(ro)
+		atomic.AddInt64(&db.failoverCount, 1)
+		db.runFailoverHooks(ctx, "ro")
+		return db.ReadWrite().QueryContext(ContextWithFailover(ctx), query, args...)
 	}
 	return ret, err
 }
@@ -213,8 +307,12 @@ func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{
 // Errors are deferred until Row's Scan method is called.
 // QueryRow uses a RO database as the physical db.
 func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
-	row := db.ReadOnly().QueryRow(query, args...)
+	ro := db.ReadOnly()
+	row := ro.QueryRow(query, args...)
 	if db.isConnectionError(row.Err()) {
+		db.evictReplica(ro)
+		atomic.AddInt64(&db.failoverCount, 1)
+		db.runFailoverHooks(context.Background(), "ro")
 		return db.ReadWrite().QueryRow(query, args...)
 	}
 	return row
@@ -223,11 +321,17 @@ func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
 // QueryRowContext executes a query that is expected to return at most one row.
 // QueryRowContext always return a non-nil value.
 // Errors are deferred until Row's Scan method is called.
-// QueryRowContext uses a RO database as the physical db.
+// QueryRowContext uses a RO database as the physical db, unless ctx was
+// derived from WithReadYourWrites and RO has not yet replayed a prior
+// write, in which case it uses RW.
 func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	row := db.ReadOnly().QueryRowContext(ctx, query, args...)
+	ro := db.resolveReadDB(ctx)
+	row := ro.QueryRowContext(ctx, query, args...)
 	if db.isConnectionError(row.Err()) {
-		return db.ReadWrite().QueryRowContext(ctx, query, args...)
+		db.evictReplica(ro)
+		atomic.AddInt64(&db.failoverCount, 1)
+		db.runFailoverHooks(ctx, "ro")
+		return db.ReadWrite().QueryRowContext(ContextWithFailover(ctx), query, args...)
 	}
 	return row
 }
@@ -238,10 +342,10 @@ func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interfa
 // new MaxIdleConns will be reduced to match the MaxOpenConns limit
 // If n <= 0, no idle connections are retained.
 func (db *DB) SetMaxIdleConns(n int) {
-	db.rwdb.SetMaxIdleConns(n)
-	if db.rodb != nil {
-		db.rodb.SetMaxIdleConns(n)
-	}
+	_ = db.forEachConn(func(conn *sql.DB) error {
+		conn.SetMaxIdleConns(n)
+		return nil
+	})
 }
 
 // SetMaxOpenConns sets the maximum number of open connections
@@ -251,28 +355,35 @@ func (db *DB) SetMaxIdleConns(n int) {
 // the new MaxOpenConns limit. If n <= 0, then there is no limit on the number
 // of open connections. The default is 0 (unlimited).
 func (db *DB) SetMaxOpenConns(n int) {
-	db.rwdb.SetMaxOpenConns(n)
-	if db.rodb != nil {
-		db.rodb.SetMaxOpenConns(n)
-	}
+	_ = db.forEachConn(func(conn *sql.DB) error {
+		conn.SetMaxOpenConns(n)
+		return nil
+	})
 }
 
 // SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
 // Expired connections may be closed lazily before reuse.
 // If d <= 0, connections are reused forever.
 func (db *DB) SetConnMaxLifetime(d time.Duration) {
-	db.rwdb.SetConnMaxLifetime(d)
-	if db.rodb != nil {
-		db.rodb.SetConnMaxLifetime(d)
-	}
+	_ = db.forEachConn(func(conn *sql.DB) error {
+		conn.SetConnMaxLifetime(d)
+		return nil
+	})
 }
 
-// ReadOnly returns the ReadOnly database
+// ReadOnly returns a ReadOnly database, selected by the configured
+// LoadBalancer from the currently healthy, non-lagging replicas. When no
+// replica is in rotation, it falls back to the RW pool.
 func (db *DB) ReadOnly() *sql.DB {
-	if db.rodb == nil {
+	live := db.liveReplicas()
+	if len(live) == 0 {
+		if len(db.replicas) > 0 {
+			atomic.AddInt64(&db.failoverCount, 1)
+			db.runFailoverHooks(context.Background(), "ro")
+		}
 		return db.rwdb
 	}
-	return db.rodb
+	return db.balancer.Next(live)
 }
 
 // ReadWrite returns the main writer physical database
@@ -280,51 +391,65 @@ func (db *DB) ReadWrite() *sql.DB {
 	return db.rwdb
 }
 
-func (db *DB) isConnectionError(err error) bool {
-	if err == nil {
-		return false
+func (db *DB) liveReplicas() []Replica {
+	live := make([]Replica, 0, len(db.replicas))
+	for _, r := range db.replicas {
+		if r.inRotation() {
+			live = append(live, Replica{DB: r.db, Weight: r.weight})
+		}
 	}
+	return live
+}
 
-	// the db in stop status will return this error, and it's not *pg.Error
-	if strings.Contains(err.Error(), "connection reset by peer") ||
-		strings.Contains(err.Error(), "connection refused") ||
-		strings.Contains(err.Error(), "timed out") ||
-		strings.Contains(err.Error(), "timeout") ||
-		strings.Contains(err.Error(), "starting up") ||
-		strings.Contains(err.Error(), "EOF") {
-		return true
+// replicaFor returns the replica wrapping conn, or nil when conn is the
+// RW pool or no longer part of db.replicas.
+func (db *DB) replicaFor(conn *sql.DB) *replica {
+	for _, r := range db.replicas {
+		if r.db == conn {
+			return r
+		}
 	}
+	return nil
+}
 
-	errPG, ok := err.(*pq.Error)
-	if !ok {
-		return false
+// evictReplica takes conn out of rotation after it has returned a
+// connection error, until the health checker re-admits it.
+func (db *DB) evictReplica(conn *sql.DB) {
+	if r := db.replicaFor(conn); r != nil {
+		atomic.StoreInt32(&r.healthy, 0)
 	}
+}
 
-	/*
-		copy from https://www.postgresql.org/docs/9.3/errcodes-appendix.html
-			"08000": "connection_exception",
-			"08003": "connection_does_not_exist",
-			"08006": "connection_failure",
-			"08001": "sqlclient_unable_to_establish_sqlconnection",
-			"08004": "sqlserver_rejected_establishment_of_sqlconnection",
-			"08007": "transaction_resolution_unknown",
-			"08P01": "protocol_violation",
-			57P01	admin_shutdown
-			57P02	crash_shutdown
-			57P03	cannot_connect_now //shutting down, restart up
-
-			53000	insufficient_resources
-			53100	disk_full
-			53200	out_of_memory
-			53300	too_many_connections
-			53400	configuration_limit_exceeded
-	*/
-	if ArrayContainsStr([]string{"08000", "08003", "08006", "08001", "08004", "08007", "08P01",
-		"57P01", "57P02", "57P03",
-		"53000", "53100", "53200", "53300", "53400"}, string(errPG.Code)) {
-		return true
+// forEachConn runs fn against RW and every replica in sequence, returning
+// the first error encountered.
+func (db *DB) forEachConn(fn func(*sql.DB) error) error {
+	if err := fn(db.rwdb); err != nil {
+		return err
 	}
-	return false
+	for _, r := range db.replicas {
+		if err := fn(r.db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachConnConcurrently runs fn against RW and every replica
+// concurrently via doParallely, returning doParallely's error.
+func (db *DB) forEachConnConcurrently(fn func(*sql.DB) error) error {
+	return doParallely(1+len(db.replicas), func(i int) error {
+		if i == 0 {
+			return fn(db.rwdb)
+		}
+		return fn(db.replicas[i-1].db)
+	})
+}
+
+func (db *DB) isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return db.classifier.IsConnectionError(err)
 }
 
 func ArrayContainsStr(arr []string, val string) bool {
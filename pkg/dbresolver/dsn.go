@@ -0,0 +1,35 @@
+package dbresolver
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// parseReplicaWeight extracts an optional "weight" query-string parameter
+// from a DSN, e.g. "postgres://host/db?weight=3", returning the DSN with
+// that parameter stripped and the parsed weight for use with
+// WeightedRandomBalancer. Defaults to 1 when the parameter is absent,
+// unparsable, or the DSN isn't URL-formatted (e.g. the classic lib/pq
+// "key=value" style, which has no query string to parse).
+func parseReplicaWeight(dsn string) (cleanDSN string, weight int) {
+	weight = 1
+
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return dsn, weight
+	}
+
+	q := u.Query()
+	raw := q.Get("weight")
+	if raw == "" {
+		return dsn, weight
+	}
+
+	if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+		weight = parsed
+	}
+	q.Del("weight")
+	u.RawQuery = q.Encode()
+
+	return u.String(), weight
+}
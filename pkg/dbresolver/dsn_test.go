@@ -0,0 +1,67 @@
+package dbresolver
+
+import "testing"
+
+func TestParseReplicaWeight(t *testing.T) {
+	tests := []struct {
+		name       string
+		dsn        string
+		wantDSN    string
+		wantWeight int
+	}{
+		{
+			name:       "no weight param",
+			dsn:        "postgres://host/db",
+			wantDSN:    "postgres://host/db",
+			wantWeight: 1,
+		},
+		{
+			name:       "explicit weight",
+			dsn:        "postgres://host/db?weight=3",
+			wantDSN:    "postgres://host/db",
+			wantWeight: 3,
+		},
+		{
+			name:       "weight alongside other params",
+			dsn:        "postgres://host/db?sslmode=disable&weight=5",
+			wantDSN:    "postgres://host/db?sslmode=disable",
+			wantWeight: 5,
+		},
+		{
+			name:       "zero weight falls back to default",
+			dsn:        "postgres://host/db?weight=0",
+			wantDSN:    "postgres://host/db",
+			wantWeight: 1,
+		},
+		{
+			name:       "negative weight falls back to default",
+			dsn:        "postgres://host/db?weight=-1",
+			wantDSN:    "postgres://host/db",
+			wantWeight: 1,
+		},
+		{
+			name:       "unparsable weight falls back to default",
+			dsn:        "postgres://host/db?weight=abc",
+			wantDSN:    "postgres://host/db",
+			wantWeight: 1,
+		},
+		{
+			name:       "lib/pq key=value style has no query string to parse",
+			dsn:        "host=localhost port=5432 dbname=mmk_be weight=3",
+			wantDSN:    "host=localhost port=5432 dbname=mmk_be weight=3",
+			wantWeight: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDSN, gotWeight := parseReplicaWeight(tt.dsn)
+			if gotDSN != tt.wantDSN {
+				t.Errorf("dsn = %q, want %q", gotDSN, tt.wantDSN)
+			}
+			if gotWeight != tt.wantWeight {
+				t.Errorf("weight = %d, want %d", gotWeight, tt.wantWeight)
+			}
+		})
+	}
+}
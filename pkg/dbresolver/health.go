@@ -0,0 +1,153 @@
+package dbresolver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHealthCheckInterval   = 5 * time.Second
+	defaultHealthCheckTimeout    = 2 * time.Second
+	defaultHealthCheckMaxBackoff = time.Minute
+)
+
+// HealthCheckConfig controls the background probe that monitors whether
+// each RO replica is reachable, so DB can fail over to RW, or to another
+// replica, without waiting for a query to fail first.
+type HealthCheckConfig struct {
+	// Interval between PingContext probes against a replica while it is
+	// healthy. Defaults to 5 seconds when zero.
+	Interval time.Duration
+	// Timeout bounds each individual probe. Defaults to 2 seconds when zero.
+	Timeout time.Duration
+	// MaxBackoff caps the exponential backoff applied between probes
+	// against a given replica after consecutive failures. Defaults to 1
+	// minute when zero.
+	MaxBackoff time.Duration
+}
+
+func (c HealthCheckConfig) withDefaults() HealthCheckConfig {
+	if c.Interval <= 0 {
+		c.Interval = defaultHealthCheckInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultHealthCheckTimeout
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultHealthCheckMaxBackoff
+	}
+	return c
+}
+
+// Stats reports the current health of each RO replica as observed by the
+// background checks, plus how many reads DB has redirected to RW because
+// of them.
+type Stats struct {
+	Replicas []ReplicaStats
+	// FailoverCount is the cumulative number of times a read was served
+	// by RW instead of RO: because a query failed, because the health
+	// checker had already evicted every replica, because a replica was
+	// lagging, or because RO had not caught up to a tracked write.
+	FailoverCount int64
+}
+
+// ReplicaStats reports a single RO replica's current health.
+type ReplicaStats struct {
+	// Healthy is true when the replica answered its last probe.
+	Healthy bool
+	// ReplicaLagExceeded is true when a ReplicaLagPolicy is configured
+	// and this replica's replication lag last exceeded MaxReplicaLag.
+	ReplicaLagExceeded bool
+}
+
+// WithHealthCheckConfig overrides the default background RO health-check
+// probe interval, timeout and backoff cap.
+func WithHealthCheckConfig(cfg HealthCheckConfig) Option {
+	return func(db *DB) {
+		db.healthCheckCfg = cfg
+	}
+}
+
+// Stats returns the current health of every RO replica and the
+// cumulative failover count.
+func (db *DB) Stats() Stats {
+	stats := Stats{FailoverCount: atomic.LoadInt64(&db.failoverCount)}
+	for _, r := range db.replicas {
+		stats.Replicas = append(stats.Replicas, ReplicaStats{
+			Healthy:            atomic.LoadInt32(&r.healthy) == 1,
+			ReplicaLagExceeded: db.lagPolicy != nil && atomic.LoadInt32(&r.lagOK) == 0,
+		})
+	}
+	return stats
+}
+
+// startHealthCheck launches one background probe goroutine per replica.
+// It is a no-op when there are no replicas.
+func (db *DB) startHealthCheck() {
+	if len(db.replicas) == 0 {
+		return
+	}
+
+	db.healthCheckCfg = db.healthCheckCfg.withDefaults()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	db.healthCheckCancel = cancel
+	db.healthCheckDone = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, r := range db.replicas {
+		wg.Add(1)
+		r := r
+		go func() {
+			defer wg.Done()
+			db.probeHealth(ctx, r)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(db.healthCheckDone)
+	}()
+}
+
+func (db *DB) probeHealth(ctx context.Context, r *replica) {
+	backoff := db.healthCheckCfg.Interval
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, db.healthCheckCfg.Timeout)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+
+		if err != nil {
+			atomic.StoreInt32(&r.healthy, 0)
+			backoff *= 2
+			if backoff > db.healthCheckCfg.MaxBackoff {
+				backoff = db.healthCheckCfg.MaxBackoff
+			}
+		} else {
+			atomic.StoreInt32(&r.healthy, 1)
+			backoff = db.healthCheckCfg.Interval
+		}
+
+		timer.Reset(backoff)
+	}
+}
+
+// stopHealthCheck shuts down every probe goroutine, blocking until all
+// have returned. Safe to call even if the probes were never started.
+func (db *DB) stopHealthCheck() {
+	if db.healthCheckCancel == nil {
+		return
+	}
+	db.healthCheckCancel()
+	<-db.healthCheckDone
+}
@@ -0,0 +1,219 @@
+package dbresolver
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultLagCheckInterval      = 2 * time.Second
+	defaultReadYourWritesTimeout = time.Second
+	readYourWritesPollInterval   = 50 * time.Millisecond
+)
+
+// ReplicaLagPolicy configures replica-lag-aware routing: when a
+// replica's lag exceeds MaxReplicaLag, DB.ReadOnly takes it out of
+// rotation instead of risking a stale read.
+type ReplicaLagPolicy struct {
+	// MaxReplicaLag is the maximum tolerated delay between a write being
+	// committed on RW and being replayed on a replica, sampled via
+	// pg_last_xact_replay_timestamp(). Zero disables lag-based routing.
+	MaxReplicaLag time.Duration
+	// CheckInterval is how often lag is sampled per replica. Defaults to 2s.
+	CheckInterval time.Duration
+	// ReadYourWritesTimeout bounds how long a read started with a
+	// WithReadYourWrites context waits for a replica to catch up to a
+	// prior write before DB reroutes it to RW. Defaults to
+	// MaxReplicaLag, or 1s if that is also zero.
+	ReadYourWritesTimeout time.Duration
+}
+
+func (p ReplicaLagPolicy) withDefaults() ReplicaLagPolicy {
+	if p.CheckInterval <= 0 {
+		p.CheckInterval = defaultLagCheckInterval
+	}
+	if p.ReadYourWritesTimeout <= 0 {
+		p.ReadYourWritesTimeout = p.MaxReplicaLag
+	}
+	if p.ReadYourWritesTimeout <= 0 {
+		p.ReadYourWritesTimeout = defaultReadYourWritesTimeout
+	}
+	return p
+}
+
+// WithReplicaLagPolicy enables replica-lag-aware routing on Open or
+// WrapDatabaseConnection. It is a no-op when there are no replicas.
+func WithReplicaLagPolicy(policy ReplicaLagPolicy) Option {
+	return func(db *DB) {
+		policy = policy.withDefaults()
+		db.lagPolicy = &policy
+	}
+}
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites returns a context derived from ctx under which writes
+// made through DB are tracked, so subsequent reads sharing that context
+// observe them even when every replica in rotation is lagging behind RW.
+// The returned context must be passed to both the write (ExecContext) and
+// the read (QueryContext/QueryRowContext) for the guarantee to apply.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, new(atomic.Value))
+}
+
+func readYourWritesTracker(ctx context.Context) *atomic.Value {
+	tracker, _ := ctx.Value(readYourWritesKey{}).(*atomic.Value)
+	return tracker
+}
+
+// startLagMonitor launches one background replica-lag probe goroutine
+// per replica when a ReplicaLagPolicy with MaxReplicaLag > 0 has been
+// configured. It is a no-op otherwise.
+func (db *DB) startLagMonitor() {
+	if len(db.replicas) == 0 || db.lagPolicy == nil || db.lagPolicy.MaxReplicaLag <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	db.lagCancel = cancel
+	db.lagDone = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, r := range db.replicas {
+		wg.Add(1)
+		r := r
+		go func() {
+			defer wg.Done()
+			db.probeLag(ctx, r)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(db.lagDone)
+	}()
+}
+
+func (db *DB) probeLag(ctx context.Context, r *replica) {
+	ticker := time.NewTicker(db.lagPolicy.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		lag, err := replicaLag(ctx, r.db)
+		if err != nil {
+			// Unable to determine lag; the health checker already
+			// handles a fully unreachable replica, so leave the flag
+			// as-is.
+			continue
+		}
+
+		healthy := int32(0)
+		if lag <= db.lagPolicy.MaxReplicaLag {
+			healthy = 1
+		}
+		atomic.StoreInt32(&r.lagOK, healthy)
+	}
+}
+
+func replicaLag(ctx context.Context, rodb *sql.DB) (time.Duration, error) {
+	var replayedAt sql.NullTime
+	err := rodb.QueryRowContext(ctx, "SELECT pg_last_xact_replay_timestamp()").Scan(&replayedAt)
+	if err != nil {
+		return 0, err
+	}
+	if !replayedAt.Valid {
+		// No transaction has been replayed yet (or this isn't a replica
+		// at all); treat it as caught up rather than perpetually lagging.
+		return 0, nil
+	}
+	return time.Since(replayedAt.Time), nil
+}
+
+// stopLagMonitor shuts down every probe goroutine, blocking until all
+// have returned. Safe to call even if the probes were never started.
+func (db *DB) stopLagMonitor() {
+	if db.lagCancel == nil {
+		return
+	}
+	db.lagCancel()
+	<-db.lagDone
+}
+
+// recordWriteLSN stashes RW's current WAL position into ctx's
+// read-your-writes tracker, if one was installed via WithReadYourWrites.
+func (db *DB) recordWriteLSN(ctx context.Context, writeErr error) {
+	if writeErr != nil || len(db.replicas) == 0 {
+		return
+	}
+	tracker := readYourWritesTracker(ctx)
+	if tracker == nil {
+		return
+	}
+	var lsn string
+	if err := db.rwdb.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()").Scan(&lsn); err == nil {
+		tracker.Store(lsn)
+	}
+}
+
+// awaitReadYourWrites blocks until ro has replayed past the LSN recorded
+// by a prior write in ctx, or the configured timeout elapses, whichever
+// comes first. It reports whether ro is caught up; callers should route
+// to RW when it returns false. Always true when ctx carries no tracker.
+func (db *DB) awaitReadYourWrites(ctx context.Context, ro *sql.DB) bool {
+	tracker := readYourWritesTracker(ctx)
+	if tracker == nil {
+		return true
+	}
+	lsn, _ := tracker.Load().(string)
+	if lsn == "" {
+		return true
+	}
+
+	deadline := time.Now().Add(db.readYourWritesTimeout())
+	for {
+		var caughtUp bool
+		err := ro.QueryRowContext(ctx, "SELECT pg_wal_lsn_diff($1, pg_last_wal_replay_lsn()) <= 0", lsn).Scan(&caughtUp)
+		if err == nil && caughtUp {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(readYourWritesPollInterval):
+		}
+	}
+}
+
+func (db *DB) readYourWritesTimeout() time.Duration {
+	if db.lagPolicy != nil && db.lagPolicy.ReadYourWritesTimeout > 0 {
+		return db.lagPolicy.ReadYourWritesTimeout
+	}
+	return defaultReadYourWritesTimeout
+}
+
+// resolveReadDB returns the pool a context-aware read should use: a
+// replica in rotation when it is caught up to ctx's tracked write (if
+// any), or RW otherwise.
+func (db *DB) resolveReadDB(ctx context.Context) *sql.DB {
+	ro := db.ReadOnly()
+	if ro == db.rwdb {
+		return ro
+	}
+	if !db.awaitReadYourWrites(ctx, ro) {
+		atomic.AddInt64(&db.failoverCount, 1)
+		db.runFailoverHooks(ctx, "ro")
+		return db.rwdb
+	}
+	return ro
+}
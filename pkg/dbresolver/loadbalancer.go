@@ -0,0 +1,105 @@
+package dbresolver
+
+import (
+	"database/sql"
+	"math/rand"
+	"sync/atomic"
+)
+
+// Replica is a single RO physical database as seen by a LoadBalancer,
+// together with the weight it was configured with (used by
+// WeightedRandomBalancer; ignored by the others).
+type Replica struct {
+	DB     *sql.DB
+	Weight int
+}
+
+// LoadBalancer selects which of the currently healthy, non-lagging RO
+// replicas should serve the next read. Next is only ever called with a
+// non-empty slice.
+type LoadBalancer interface {
+	Next(replicas []Replica) *sql.DB
+}
+
+// RoundRobinBalancer cycles through replicas in order. It is the default
+// LoadBalancer.
+type RoundRobinBalancer struct {
+	counter uint64
+}
+
+// NewRoundRobinBalancer returns a LoadBalancer that cycles through
+// replicas in order.
+func NewRoundRobinBalancer() *RoundRobinBalancer {
+	return &RoundRobinBalancer{}
+}
+
+func (b *RoundRobinBalancer) Next(replicas []Replica) *sql.DB {
+	n := atomic.AddUint64(&b.counter, 1)
+	return replicas[(n-1)%uint64(len(replicas))].DB
+}
+
+// RandomBalancer picks a replica uniformly at random.
+type RandomBalancer struct{}
+
+// NewRandomBalancer returns a LoadBalancer that picks a replica uniformly
+// at random.
+func NewRandomBalancer() *RandomBalancer {
+	return &RandomBalancer{}
+}
+
+func (RandomBalancer) Next(replicas []Replica) *sql.DB {
+	return replicas[rand.Intn(len(replicas))].DB
+}
+
+// LeastConnectionsBalancer picks the replica with the fewest in-use
+// connections, per sql.DB.Stats().InUse.
+type LeastConnectionsBalancer struct{}
+
+// NewLeastConnectionsBalancer returns a LoadBalancer that picks the
+// replica with the fewest in-use connections.
+func NewLeastConnectionsBalancer() *LeastConnectionsBalancer {
+	return &LeastConnectionsBalancer{}
+}
+
+func (LeastConnectionsBalancer) Next(replicas []Replica) *sql.DB {
+	best := replicas[0]
+	bestInUse := best.DB.Stats().InUse
+	for _, r := range replicas[1:] {
+		if inUse := r.DB.Stats().InUse; inUse < bestInUse {
+			best, bestInUse = r, inUse
+		}
+	}
+	return best.DB
+}
+
+// WeightedRandomBalancer picks a replica at random, weighted by
+// Replica.Weight. Replicas with Weight <= 0 are treated as weight 1.
+type WeightedRandomBalancer struct{}
+
+// NewWeightedRandomBalancer returns a LoadBalancer that picks a replica
+// at random, weighted by Replica.Weight.
+func NewWeightedRandomBalancer() *WeightedRandomBalancer {
+	return &WeightedRandomBalancer{}
+}
+
+func (WeightedRandomBalancer) Next(replicas []Replica) *sql.DB {
+	total := 0
+	for _, r := range replicas {
+		total += replicaWeight(r)
+	}
+	pick := rand.Intn(total)
+	for _, r := range replicas {
+		pick -= replicaWeight(r)
+		if pick < 0 {
+			return r.DB
+		}
+	}
+	return replicas[len(replicas)-1].DB
+}
+
+func replicaWeight(r Replica) int {
+	if r.Weight <= 0 {
+		return 1
+	}
+	return r.Weight
+}
@@ -0,0 +1,89 @@
+package dbresolver
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func testReplicas(n int) []Replica {
+	replicas := make([]Replica, n)
+	for i := range replicas {
+		// A *sql.DB with no driver registered is never used beyond
+		// identity comparison and Stats() in these tests.
+		replicas[i] = Replica{DB: &sql.DB{}}
+	}
+	return replicas
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	replicas := testReplicas(3)
+	b := NewRoundRobinBalancer()
+
+	var got []*sql.DB
+	for i := 0; i < 6; i++ {
+		got = append(got, b.Next(replicas))
+	}
+
+	for i, db := range got {
+		want := replicas[i%3].DB
+		if db != want {
+			t.Errorf("call %d: got replica %d, want replica %d", i, indexOf(replicas, db), indexOf(replicas, want))
+		}
+	}
+}
+
+func TestRandomBalancer(t *testing.T) {
+	replicas := testReplicas(3)
+	b := RandomBalancer{}
+
+	for i := 0; i < 20; i++ {
+		got := b.Next(replicas)
+		if indexOf(replicas, got) == -1 {
+			t.Fatalf("Next returned a *sql.DB not in replicas")
+		}
+	}
+}
+
+func TestLeastConnectionsBalancer(t *testing.T) {
+	replicas := testReplicas(3)
+	b := LeastConnectionsBalancer{}
+
+	// All replicas report zero in-use connections (bare *sql.DB), so the
+	// first one should win ties.
+	got := b.Next(replicas)
+	if got != replicas[0].DB {
+		t.Errorf("got replica %d, want replica 0", indexOf(replicas, got))
+	}
+}
+
+func TestWeightedRandomBalancer(t *testing.T) {
+	replicas := []Replica{
+		{DB: &sql.DB{}, Weight: 0}, // treated as weight 1
+		{DB: &sql.DB{}, Weight: 9},
+	}
+	b := WeightedRandomBalancer{}
+
+	counts := make(map[*sql.DB]int)
+	const trials = 1000
+	for i := 0; i < trials; i++ {
+		counts[b.Next(replicas)]++
+	}
+
+	if counts[replicas[0].DB] == 0 || counts[replicas[1].DB] == 0 {
+		t.Fatalf("expected both replicas to be picked at least once, got %v", counts)
+	}
+	// The weight-9 replica should dominate a weight-1 replica heavily
+	// over enough trials.
+	if counts[replicas[1].DB] < counts[replicas[0].DB]*3 {
+		t.Errorf("expected replica 1 (weight 9) to be picked much more often than replica 0 (weight 1), got %v", counts)
+	}
+}
+
+func indexOf(replicas []Replica, db *sql.DB) int {
+	for i, r := range replicas {
+		if r.DB == db {
+			return i
+		}
+	}
+	return -1
+}
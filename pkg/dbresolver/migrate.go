@@ -0,0 +1,184 @@
+package dbresolver
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+)
+
+const defaultMigrationsTable = "schema_migrations"
+
+// MigrationConfig controls how Migrate/Rollback/Version/Force drive
+// github.com/golang-migrate/migrate/v4 against the RW database, over a
+// dedicated connection rather than the RW pool (see WithMigrationConn).
+type MigrationConfig struct {
+	// MultiStatement allows a single migration file to contain more than
+	// one semicolon-separated statement (x-multi-statement).
+	MultiStatement bool
+	// StatementTimeout bounds how long a single migration statement may
+	// run before Postgres cancels it (x-statement-timeout). Zero means
+	// no timeout.
+	StatementTimeout time.Duration
+	// MigrationsTable overrides the table golang-migrate uses to track
+	// applied versions (x-migrations-table). Defaults to
+	// "schema_migrations".
+	MigrationsTable string
+}
+
+func (c MigrationConfig) withDefaults() MigrationConfig {
+	if c.MigrationsTable == "" {
+		c.MigrationsTable = defaultMigrationsTable
+	}
+	return c
+}
+
+func (c MigrationConfig) driverConfig() *pgxmigrate.Config {
+	return &pgxmigrate.Config{
+		MigrationsTable:       c.MigrationsTable,
+		StatementTimeout:      c.StatementTimeout,
+		MultiStatementEnabled: c.MultiStatement,
+	}
+}
+
+// MigrateOption configures a single Migrate call.
+type MigrateOption func(*MigrationConfig)
+
+// WithMultiStatement allows a single migration file to contain more than
+// one semicolon-separated statement.
+func WithMultiStatement() MigrateOption {
+	return func(c *MigrationConfig) {
+		c.MultiStatement = true
+	}
+}
+
+// WithStatementTimeout bounds how long a single migration statement may
+// run before Postgres cancels it.
+func WithStatementTimeout(d time.Duration) MigrateOption {
+	return func(c *MigrationConfig) {
+		c.StatementTimeout = d
+	}
+}
+
+// WithMigrationsTable overrides the table golang-migrate uses to track
+// applied versions.
+func WithMigrationsTable(name string) MigrateOption {
+	return func(c *MigrationConfig) {
+		c.MigrationsTable = name
+	}
+}
+
+// Migrate applies all pending "up" migrations found at sourceURL (e.g.
+// "file://migrations") against the RW database. The sourceURL and config are
+// remembered so Rollback, Version and Force can be called afterwards
+// without repeating them.
+func (db *DB) Migrate(sourceURL string, opts ...MigrateOption) error {
+	cfg := MigrationConfig{}.withDefaults()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	db.migrateSourceURL = sourceURL
+	db.migrateCfg = cfg
+
+	m, err := db.newMigrate()
+	if err != nil {
+		return err
+	}
+	defer closeMigrate(m)
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Rollback reverts the given number of migrations against the RW database.
+// Migrate must have been called first, to establish the migration source
+// and config. Pass a negative steps to roll back every migration.
+func (db *DB) Rollback(steps int) error {
+	m, err := db.newMigrate()
+	if err != nil {
+		return err
+	}
+	defer closeMigrate(m)
+	if steps < 0 {
+		if err := m.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+		return nil
+	}
+	if err := m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Version reports the migration version currently applied against the RW
+// database, and whether a prior migration attempt left the schema dirty.
+func (db *DB) Version() (version uint, dirty bool, err error) {
+	m, err := db.newMigrate()
+	if err != nil {
+		return 0, false, err
+	}
+	defer closeMigrate(m)
+	return m.Version()
+}
+
+// Force sets the migration version without running any migrations,
+// clearing the dirty flag. Use this to recover after a migration failed
+// partway through and left the schema in an inconsistent state.
+func (db *DB) Force(version int) error {
+	m, err := db.newMigrate()
+	if err != nil {
+		return err
+	}
+	defer closeMigrate(m)
+	return m.Force(version)
+}
+
+// newMigrate builds a *migrate.Migrate wired to a dedicated connection
+// opened from migrateDriverName/migrateDSN via the pgx/v5 database
+// driver. It is rebuilt on every call rather than cached, since it is
+// cheap relative to the migrations it runs. The caller must close the
+// returned *migrate.Migrate (via closeMigrate) once done with it, or the
+// dedicated connection it opened is never released.
+func (db *DB) newMigrate() (*migrate.Migrate, error) {
+	if db.migrateSourceURL == "" {
+		return nil, errors.New("dbresolver: Migrate must be called before Rollback, Version or Force")
+	}
+	if db.migrateDriverName == "" || db.migrateDSN == "" {
+		return nil, errors.New("dbresolver: no driver/DSN to migrate with; pass WithMigrationConn")
+	}
+
+	// Opened specifically for the migrate driver rather than handing it
+	// db.ReadWrite(), so closeMigrate can fully close it afterwards
+	// without tearing down the shared RW pool: golang-migrate's Close()
+	// closes both the *sql.Conn it checks out and the *sql.DB it was
+	// given.
+	migrateDB, err := sql.Open(db.migrateDriverName, db.migrateDSN)
+	if err != nil {
+		return nil, fmt.Errorf("dbresolver: open migrate connection: %w", err)
+	}
+
+	driver, err := pgxmigrate.WithInstance(migrateDB, db.migrateCfg.driverConfig())
+	if err != nil {
+		migrateDB.Close()
+		return nil, fmt.Errorf("dbresolver: build migrate driver: %w", err)
+	}
+
+	m, err := migrate.NewWithDatabaseInstance(db.migrateSourceURL, "pgx/v5", driver)
+	if err != nil {
+		migrateDB.Close()
+		return nil, fmt.Errorf("dbresolver: build migrate instance: %w", err)
+	}
+	return m, nil
+}
+
+// closeMigrate releases the dedicated connection newMigrate opened,
+// discarding the error the way the rest of this package treats cleanup
+// on an already-succeeding or already-failing path.
+func closeMigrate(m *migrate.Migrate) {
+	_, _ = m.Close()
+}
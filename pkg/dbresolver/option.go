@@ -0,0 +1,117 @@
+package dbresolver
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Option configures a DB at construction time, via Open or
+// WrapDatabaseConnection.
+type Option func(*DB)
+
+// Combine returns an Option that applies each of opts in order. Useful
+// for packages that bundle several Options behind one exported function.
+func Combine(opts ...Option) Option {
+	return func(db *DB) {
+		for _, opt := range opts {
+			opt(db)
+		}
+	}
+}
+
+// ConnOpener replaces how Open obtains each underlying *sql.DB, in place
+// of sql.Open. role is "rw" or "ro". Install via WithConnOpener.
+type ConnOpener func(role, driverName, dataSourceName string) (*sql.DB, error)
+
+// WithConnOpener overrides how Open opens each underlying connection.
+// Has no effect on WrapDatabaseConnection, whose connections are already
+// open. Intended for packages that need to swap in an instrumented
+// driver, e.g. pkg/dbresolver/otel.
+func WithConnOpener(opener ConnOpener) Option {
+	return func(db *DB) {
+		db.connOpener = opener
+	}
+}
+
+// ConnDecorator runs against every underlying *sql.DB once it is known to
+// DB, whether opened by Open or passed into WrapDatabaseConnection.
+// role is "rw" or "ro". Install via WithConnDecorator.
+type ConnDecorator func(conn *sql.DB, role string)
+
+// WithConnDecorator registers a ConnDecorator to run against RW and
+// every replica. Multiple decorators compose; each runs in the order
+// registered. Intended for packages that attach side-channel
+// instrumentation without needing to wrap the driver itself, e.g.
+// pkg/dbresolver/otel registering connection-pool metrics.
+func WithConnDecorator(dec ConnDecorator) Option {
+	return func(db *DB) {
+		db.connDecorators = append(db.connDecorators, dec)
+	}
+}
+
+// FailoverHook is called whenever DB serves a read from RW instead of
+// the preferred RO pool, e.g. because RO failed, was unhealthy, was
+// lagging, or had not caught up to a tracked write. role is the role the
+// read was taken away from, which is always "ro". Install via
+// WithFailoverHook.
+type FailoverHook func(ctx context.Context, role string)
+
+// WithFailoverHook registers a FailoverHook, e.g. for packages that want
+// to emit a trace span or log line when DB fails over. Multiple hooks
+// compose; each runs in the order registered.
+func WithFailoverHook(hook FailoverHook) Option {
+	return func(db *DB) {
+		db.failoverHooks = append(db.failoverHooks, hook)
+	}
+}
+
+type failoverKey struct{}
+
+// ContextWithFailover returns a context derived from ctx marking that the
+// call it carries was rerouted from RO to RW after a failed read. DB sets
+// this on the context passed to the retried RW call, so instrumentation
+// installed via WithConnOpener (e.g. pkg/dbresolver/otel) can tag the
+// query span that triggered the failover instead of only a FailoverHook
+// fired on the side.
+func ContextWithFailover(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failoverKey{}, true)
+}
+
+// IsFailover reports whether ctx was marked via ContextWithFailover.
+func IsFailover(ctx context.Context) bool {
+	v, _ := ctx.Value(failoverKey{}).(bool)
+	return v
+}
+
+// WithErrorClassifier selects the ErrorClassifier used to detect RO
+// connection failures. Pass this when the underlying driver is not
+// github.com/lib/pq, e.g. PGXV5Classifier{} for jackc/pgx/v5. Defaults to
+// PQClassifier{} when not provided.
+func WithErrorClassifier(c ErrorClassifier) Option {
+	return func(db *DB) {
+		db.classifier = c
+	}
+}
+
+// WithLoadBalancer selects the strategy used to spread reads across RO
+// replicas, e.g. NewLeastConnectionsBalancer() or
+// NewWeightedRandomBalancer(). Defaults to NewRoundRobinBalancer() when
+// not provided.
+func WithLoadBalancer(lb LoadBalancer) Option {
+	return func(db *DB) {
+		db.balancer = lb
+	}
+}
+
+// WithMigrationConn tells Migrate, Rollback, Version and Force which
+// driver and DSN to use for their own short-lived connection, instead of
+// borrowing one from the RW pool. Open sets this from its own driverName
+// and RW DSN automatically; pass it explicitly to override that, or when
+// constructing DB via WrapDatabaseConnection, which has no DSN of its
+// own to default to.
+func WithMigrationConn(driverName, dataSourceName string) Option {
+	return func(db *DB) {
+		db.migrateDriverName = driverName
+		db.migrateDSN = dataSourceName
+	}
+}
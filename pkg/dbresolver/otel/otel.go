@@ -0,0 +1,63 @@
+// Package otel provides an optional OpenTelemetry integration for
+// dbresolver.DB, kept in a separate package so importing dbresolver
+// itself doesn't pull in the OpenTelemetry SDK for applications that
+// don't need tracing or metrics.
+package otel
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/billygrinding/mmk-be/pkg/dbresolver"
+)
+
+// WithTracer instruments every connection dbresolver.Open opens with
+// github.com/XSAM/otelsql, so Query/Exec/Prepare calls produce spans
+// tagged with a db.mmk.role attribute ("rw" or "ro"). The span for a
+// context-aware query DB rerouted from RO to RW after a failed read is
+// additionally tagged db.mmk.failover=true, via the
+// dbresolver.ContextWithFailover marker DB sets on that call's context.
+//
+// Only affects connections opened by dbresolver.Open; WrapDatabaseConnection
+// wraps already-opened *sql.DB handles, which otelsql cannot retrofit.
+func WithTracer(tp trace.TracerProvider) dbresolver.Option {
+	return dbresolver.WithConnOpener(func(role, driverName, dsn string) (*sql.DB, error) {
+		return otelsql.Open(driverName, dsn,
+			otelsql.WithTracerProvider(tp),
+			otelsql.WithAttributes(attribute.String("db.mmk.role", role)),
+			otelsql.WithAttributesGetter(failoverAttributes),
+		)
+	})
+}
+
+// failoverAttributes tags a query span with db.mmk.failover=true when its
+// context was marked via dbresolver.ContextWithFailover, i.e. when this
+// call is DB retrying a failed RO read against RW.
+func failoverAttributes(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) []attribute.KeyValue {
+	if !dbresolver.IsFailover(ctx) {
+		return nil
+	}
+	return []attribute.KeyValue{attribute.Bool("db.mmk.failover", true)}
+}
+
+// WithMeter registers sql.DB.Stats()-derived connection-pool gauges
+// (idle and in-use counts) for every connection dbresolver.Open opens or
+// WrapDatabaseConnection wraps, tagged with a db.mmk.role attribute
+// ("rw" or "ro").
+func WithMeter(mp metric.MeterProvider) dbresolver.Option {
+	return dbresolver.WithConnDecorator(func(conn *sql.DB, role string) {
+		// Registration only fails on a duplicate instrument name for the
+		// same conn, which can't happen here; dbresolver.decorateConns
+		// runs this once per connection.
+		_ = otelsql.RegisterDBStatsMetrics(conn,
+			otelsql.WithMeterProvider(mp),
+			otelsql.WithAttributes(attribute.String("db.mmk.role", role)),
+		)
+	})
+}
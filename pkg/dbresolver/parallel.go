@@ -0,0 +1,30 @@
+package dbresolver
+
+import "sync"
+
+// doParallely runs fn(i) concurrently for every i in [0, n), waiting for
+// all n calls to return before reporting an error, so callers don't leak
+// a goroutine still touching a *sql.DB the caller has moved on from.
+// Reports the error from the lowest index that failed, so the outcome is
+// deterministic across runs even though fn itself runs unordered.
+func doParallely(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,19 +2,32 @@ package dbresolver
 
 import "database/sql"
 
-// WrapDatabaseConnection will wrap to DB connection between RW and RO database
-func WrapDatabaseConnection(rwDB, roDB *sql.DB) *DB {
+// WrapDatabaseConnection wraps already-opened connections into a DB, with
+// rwDB as the RW pool and roDBs as the set of RO replicas. roDBs may be
+// nil or empty, in which case reads also go to rwDB.
+//
+// Unlike Open, WrapDatabaseConnection never sees a driver name or DSN, so
+// Migrate has nothing to open its own short-lived connection from. Pass
+// WithMigrationConn if the returned DB will call Migrate, Rollback,
+// Version or Force.
+func WrapDatabaseConnection(rwDB *sql.DB, roDBs []*sql.DB, opts ...Option) *DB {
 	if rwDB == nil {
 		panic("RW Database is required")
 	}
-	totalConnection := 1
-	if roDB != nil {
-		totalConnection = 2
+
+	replicas := make([]*replica, len(roDBs))
+	for i, roDB := range roDBs {
+		replicas[i] = &replica{db: roDB, weight: 1, healthy: 1, lagOK: 1}
 	}
 
-	return &DB{
-		rwdb:            rwDB,
-		rodb:            roDB,
-		totalConnection: totalConnection,
+	db := &DB{
+		rwdb:     rwDB,
+		replicas: replicas,
 	}
+	applyOptions(db, opts)
+	db.decorateConns()
+	db.startHealthCheck()
+	db.startLagMonitor()
+
+	return db
 }
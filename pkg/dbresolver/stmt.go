@@ -0,0 +1,154 @@
+package dbresolver
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+)
+
+// Stmt is a prepared statement held open against RW and every RO
+// replica, returned by DB.Prepare/PrepareContext. It mirrors DB's own
+// query methods: writes always go to RW, reads are spread across
+// replicas currently in rotation by the configured LoadBalancer and fail
+// over to RW on a connection error, like DB.Query. Unlike
+// DB.QueryContext, the context-aware reads do not wait for a
+// WithReadYourWrites write to be replayed, and the RW retry is not marked
+// via ContextWithFailover.
+type Stmt interface {
+	Close() error
+	Exec(args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error)
+	Query(args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error)
+	QueryRow(args ...interface{}) *sql.Row
+	QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row
+}
+
+// stmt is the Stmt implementation. rostmts[i] is the prepared statement
+// on db.replicas[i], kept at the same index so the health/lag state
+// DB already tracks per replica can be looked up by index.
+type stmt struct {
+	db      *DB
+	rwstmt  *sql.Stmt
+	rostmts []*sql.Stmt
+}
+
+// Close closes the prepared statement on RW and every replica, returning
+// the first error encountered.
+func (s *stmt) Close() error {
+	if err := s.rwstmt.Close(); err != nil {
+		return err
+	}
+	for _, rostmt := range s.rostmts {
+		if err := rostmt.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exec executes the prepared statement against RW.
+func (s *stmt) Exec(args ...interface{}) (sql.Result, error) {
+	return s.rwstmt.Exec(args...)
+}
+
+// ExecContext executes the prepared statement against RW.
+func (s *stmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	return s.rwstmt.ExecContext(ctx, args...)
+}
+
+// Query executes the prepared statement against a replica in rotation,
+// falling back to RW when the replica returns a connection error.
+func (s *stmt) Query(args ...interface{}) (*sql.Rows, error) {
+	idx, ro := s.readOnly()
+	if ro == nil {
+		return s.rwstmt.Query(args...)
+	}
+	rows, err := ro.Query(args...)
+	if s.db.isConnectionError(err) {
+		s.evict(idx)
+		return s.rwstmt.Query(args...)
+	}
+	return rows, err
+}
+
+// QueryContext executes the prepared statement against a replica in
+// rotation, falling back to RW when the replica returns a connection
+// error.
+func (s *stmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	idx, ro := s.readOnly()
+	if ro == nil {
+		return s.rwstmt.QueryContext(ctx, args...)
+	}
+	rows, err := ro.QueryContext(ctx, args...)
+	if s.db.isConnectionError(err) {
+		s.evict(idx)
+		return s.rwstmt.QueryContext(ctx, args...)
+	}
+	return rows, err
+}
+
+// QueryRow executes the prepared statement against a replica in
+// rotation, falling back to RW when the replica returns a connection
+// error.
+func (s *stmt) QueryRow(args ...interface{}) *sql.Row {
+	idx, ro := s.readOnly()
+	if ro == nil {
+		return s.rwstmt.QueryRow(args...)
+	}
+	row := ro.QueryRow(args...)
+	if s.db.isConnectionError(row.Err()) {
+		s.evict(idx)
+		return s.rwstmt.QueryRow(args...)
+	}
+	return row
+}
+
+// QueryRowContext executes the prepared statement against a replica in
+// rotation, falling back to RW when the replica returns a connection
+// error.
+func (s *stmt) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
+	idx, ro := s.readOnly()
+	if ro == nil {
+		return s.rwstmt.QueryRowContext(ctx, args...)
+	}
+	row := ro.QueryRowContext(ctx, args...)
+	if s.db.isConnectionError(row.Err()) {
+		s.evict(idx)
+		return s.rwstmt.QueryRowContext(ctx, args...)
+	}
+	return row
+}
+
+// readOnly returns the index into rostmts/db.replicas of the replica's
+// prepared statement picked by the configured LoadBalancer, or (-1, nil)
+// when none are in rotation and the caller should use rwstmt instead.
+func (s *stmt) readOnly() (int, *sql.Stmt) {
+	live := s.db.liveReplicas()
+	if len(live) == 0 {
+		if len(s.db.replicas) > 0 {
+			atomic.AddInt64(&s.db.failoverCount, 1)
+			s.db.runFailoverHooks(context.Background(), "ro")
+		}
+		return -1, nil
+	}
+
+	conn := s.db.balancer.Next(live)
+	for i, r := range s.db.replicas {
+		if r.db == conn {
+			return i, s.rostmts[i]
+		}
+	}
+	return -1, nil
+}
+
+// evict takes the replica at idx out of rotation after its statement
+// returned a connection error, until the health checker re-admits it.
+func (s *stmt) evict(idx int) {
+	if idx < 0 || idx >= len(s.db.replicas) {
+		return
+	}
+	atomic.StoreInt32(&s.db.replicas[idx].healthy, 0)
+	atomic.AddInt64(&s.db.failoverCount, 1)
+	s.db.runFailoverHooks(context.Background(), "ro")
+}
@@ -0,0 +1,200 @@
+// Package testctr provides a postgres.Suite equivalent that provisions
+// its own database via testcontainers-go instead of requiring one at an
+// externally provisioned DSN. Each test restores a snapshot taken once
+// in SetupSuite rather than re-running migrations, so tests stay
+// isolated without paying the cost of restarting the container.
+package testctr
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/billygrinding/mmk-be/pkg/dbresolver"
+
+	"github.com/lib/pq"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	// This is imported for migrations
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "github.com/lib/pq"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	postgresDriver = "postgres"
+
+	// maintenanceDB is the database testcontainers-go's postgres module
+	// always provisions, used to DROP/CREATE DBName since Postgres
+	// refuses either statement against the database a connection is
+	// currently using.
+	maintenanceDB = "postgres"
+
+	defaultSnapshotName = "mmk_be_snapshot"
+	defaultDBName       = "mmk_be"
+)
+
+const timeoutForDBPing = time.Second * 10
+
+// Suite is a postgres.Suite equivalent backed by a testcontainers-go
+// Postgres container instead of an externally provisioned database.
+type Suite struct {
+	suite.Suite
+
+	// MigrationLocationFolder is passed to DBConn.Migrate as
+	// "file://<folder>" during SetupSuite.
+	MigrationLocationFolder string
+	// DBName is the database created inside the container, migrated,
+	// and restored before every test. Defaults to "mmk_be".
+	DBName string
+
+	DBConn *dbresolver.DB
+
+	snapshot  string
+	container *tcpostgres.PostgresContainer
+	dsn       string
+	maintDSN  string
+}
+
+// SnapshotName overrides the name of the template database SetupSuite
+// snapshots into and Restore restores from. Defaults to "mmk_be_snapshot".
+// Must be called before SetupSuite runs.
+func (s *Suite) SnapshotName(name string) {
+	s.snapshot = name
+}
+
+// SetupSuite starts the container, applies migrations once, and takes a
+// snapshot of the resulting schema+data that Restore restores from.
+func (s *Suite) SetupSuite() {
+	ctx := context.Background()
+
+	if s.snapshot == "" {
+		s.snapshot = defaultSnapshotName
+	}
+	if s.DBName == "" {
+		s.DBName = defaultDBName
+	}
+
+	container, err := tcpostgres.RunContainer(ctx,
+		testcontainers.WithImage("postgres:16-alpine"),
+		tcpostgres.WithDatabase(s.DBName),
+		tcpostgres.WithUsername("user"),
+		tcpostgres.WithPassword("password"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(time.Minute),
+		),
+	)
+	s.Require().NoError(err)
+	s.container = container
+
+	s.dsn, err = container.ConnectionString(ctx, "sslmode=disable")
+	s.Require().NoError(err)
+
+	host, err := container.Host(ctx)
+	s.Require().NoError(err)
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	s.Require().NoError(err)
+	s.maintDSN = fmt.Sprintf("postgres://user:password@%s:%s/%s?sslmode=disable", host, port.Port(), maintenanceDB)
+
+	s.openDBConn()
+
+	_, extErr := s.DBConn.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\";")
+	s.Require().NoError(extErr)
+
+	err = s.DBConn.Migrate(fmt.Sprintf("file://%s", s.MigrationLocationFolder))
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.takeSnapshot(ctx))
+}
+
+// SetupTest restores the snapshot taken in SetupSuite before every test,
+// giving each one a pristine schema+data state.
+func (s *Suite) SetupTest() {
+	s.Restore()
+}
+
+// TearDownSuite closes the connection pool and terminates the container.
+func (s *Suite) TearDownSuite() {
+	if s.DBConn != nil {
+		s.Require().NoError(s.DBConn.Close())
+	}
+	s.Require().NoError(s.container.Terminate(context.Background()))
+}
+
+// Restore drops DBName and recreates it from the snapshot taken in
+// SetupSuite. Because dropping a database requires no other connection
+// be using it, this connects via the container's maintenance "postgres"
+// database rather than DBName itself.
+func (s *Suite) Restore() {
+	ctx := context.Background()
+
+	if s.DBConn != nil {
+		s.Require().NoError(s.DBConn.Close())
+	}
+
+	maintConn, err := sql.Open(postgresDriver, s.maintDSN)
+	s.Require().NoError(err)
+	defer maintConn.Close()
+
+	s.Require().NoError(s.recreateFromTemplate(ctx, maintConn, s.DBName, s.snapshot))
+
+	s.openDBConn()
+}
+
+// takeSnapshot captures DBConn's current schema+data into the template
+// database Restore restores from, via CREATE DATABASE ... TEMPLATE. The
+// source database must have no other connections at the time, so DBConn
+// is closed first and the snapshot is taken over a separate connection to
+// the maintenance database. DBConn is left closed; Restore reopens it.
+func (s *Suite) takeSnapshot(ctx context.Context) error {
+	if err := s.DBConn.Close(); err != nil {
+		return err
+	}
+
+	maintConn, err := sql.Open(postgresDriver, s.maintDSN)
+	if err != nil {
+		return err
+	}
+	defer maintConn.Close()
+
+	if _, err := maintConn.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(s.snapshot))); err != nil {
+		return err
+	}
+	_, err = maintConn.ExecContext(ctx,
+		fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", pq.QuoteIdentifier(s.snapshot), pq.QuoteIdentifier(s.DBName)))
+	return err
+}
+
+// recreateFromTemplate drops name and recreates it from template, using
+// conn (expected to be connected to the maintenance database).
+func (s *Suite) recreateFromTemplate(ctx context.Context, conn *sql.DB, name, template string) error {
+	_, err := conn.ExecContext(ctx,
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()", name)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(name))); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx,
+		fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", pq.QuoteIdentifier(name), pq.QuoteIdentifier(template)))
+	return err
+}
+
+// openDBConn (re)opens DBConn against DBName and waits for it to accept
+// connections.
+func (s *Suite) openDBConn() {
+	dbConn, err := sql.Open(postgresDriver, s.dsn)
+	s.Require().NoError(err)
+	s.DBConn = dbresolver.WrapDatabaseConnection(dbConn, nil, dbresolver.WithMigrationConn(postgresDriver, s.dsn))
+
+	pingCtx, cancel := context.WithTimeout(context.Background(), timeoutForDBPing)
+	defer cancel()
+	s.Require().NoError(s.DBConn.PingContext(pingCtx))
+}
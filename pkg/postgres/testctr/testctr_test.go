@@ -0,0 +1,37 @@
+//go:build integration
+
+package testctr_test
+
+import (
+	"testing"
+
+	"github.com/billygrinding/mmk-be/pkg/postgres/testctr"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// smokeSuite exercises testctr.Suite end-to-end: that it provisions a
+// container, applies the migration in testdata/migrations, and that
+// Restore leaves DBConn usable afterwards.
+type smokeSuite struct {
+	testctr.Suite
+}
+
+func (s *smokeSuite) TestRestoreLeavesDBConnUsable() {
+	s.Require().NoError(s.DBConn.Ping())
+
+	_, err := s.DBConn.Exec("INSERT INTO smoke DEFAULT VALUES")
+	s.Require().NoError(err)
+
+	s.Restore()
+
+	var count int
+	s.Require().NoError(s.DBConn.QueryRow("SELECT count(*) FROM smoke").Scan(&count))
+	s.Require().Zero(count, "Restore should have reverted the insert")
+}
+
+func TestSmokeSuite(t *testing.T) {
+	s := &smokeSuite{}
+	s.MigrationLocationFolder = "testdata/migrations"
+	suite.Run(t, s)
+}